@@ -5,19 +5,24 @@ import (
 	"encoding/binary"
 	"fmt"
 	"io"
+	"math"
 )
 
 type Encoder struct {
-	err error
-	buf *bytes.Buffer
-	bo  binary.ByteOrder
+	err      error
+	buf      *bytes.Buffer
+	out      io.Writer // if non-nil, takes over from buf; see SetWriter.
+	bo       binary.ByteOrder
+	implicit bool
 }
 
-func NewEncoder(bo binary.ByteOrder) *Encoder {
+func NewEncoder(bo binary.ByteOrder, implicit IsImplicitVR) *Encoder {
 	return &Encoder{
-		err: nil,
-		buf: &bytes.Buffer{},
-		bo:  bo}
+		err:      nil,
+		buf:      &bytes.Buffer{},
+		bo:       bo,
+		implicit: bool(implicit),
+	}
 }
 
 func (e *Encoder) SetError(err error) {
@@ -26,36 +31,76 @@ func (e *Encoder) SetError(err error) {
 	}
 }
 
+func (e *Encoder) Error() error { return e.err }
+
+// SetWriter redirects subsequent Encode* calls straight to "out" instead of
+// buffering them in memory, so a multi-GB write (e.g. encapsulated pixel
+// data) doesn't have to fit in a bytes.Buffer first. Anything encoded
+// before the switch is flushed to "out" first.
+func (e *Encoder) SetWriter(out io.Writer) {
+	if e.buf.Len() > 0 {
+		if _, err := out.Write(e.buf.Bytes()); err != nil {
+			e.SetError(err)
+		}
+		e.buf.Reset()
+	}
+	e.out = out
+}
+
+// Finish returns the bytes encoded so far and any error encountered. Once
+// SetWriter has been called, those bytes have already been written to the
+// given io.Writer, so Finish returns nil instead of re-returning them.
 func (e *Encoder) Finish() ([]byte, error) {
+	if e.out != nil {
+		return nil, e.err
+	}
 	return e.buf.Bytes(), e.err
 }
 
+// write is the common sink for every Encode* method: either "out", if
+// SetWriter was called, or the in-memory buffer otherwise.
+func (e *Encoder) write(p []byte) {
+	if e.err != nil {
+		return
+	}
+	if e.out != nil {
+		if _, err := e.out.Write(p); err != nil {
+			e.err = err
+		}
+		return
+	}
+	e.buf.Write(p)
+}
+
 func (e *Encoder) EncodeByte(v byte) {
-	binary.Write(e.buf, e.bo, &v)
+	e.write([]byte{v})
 }
 
 func (e *Encoder) EncodeUInt16(v uint16) {
-	binary.Write(e.buf, e.bo, &v)
+	b := make([]byte, 2)
+	e.bo.PutUint16(b, v)
+	e.write(b)
 }
 
 func (e *Encoder) EncodeUInt32(v uint32) {
-	binary.Write(e.buf, e.bo, &v)
+	b := make([]byte, 4)
+	e.bo.PutUint32(b, v)
+	e.write(b)
 }
 
 func (e *Encoder) EncodeString(v string) {
-	e.buf.Write([]byte(v))
+	e.write([]byte(v))
 }
 
 // Encode an array of zero bytes.
 func (e *Encoder) EncodeZeros(len int) {
 	// TODO(saito) reuse the buffer!
-	zeros := make([]byte, len)
-	e.buf.Write(zeros)
+	e.write(make([]byte, len))
 }
 
 // Copy the given data to the output.
 func (e *Encoder) EncodeBytes(v []byte) {
-	e.buf.Write(v)
+	e.write(v)
 }
 
 type Decoder struct {
@@ -77,11 +122,18 @@ type Decoder struct {
 	//
 	// INVARIANT: limits[] store values in decreasing order.
 	// limits []int64
+
+	// Bytes already pulled from "in" but not yet handed back to a caller of
+	// Read. Populated by PeekTag; drained by Read before it touches "in"
+	// again. This lets a caller inspect the next element's tag without
+	// disturbing the normal decode path.
+	peek []byte
 }
 
-// limit is the maximum number of read from "in". Don't pass just an arbitrary
-// large number as the limit. The underlying code assumes that "limit"
-// accurately bounds the end of the data.
+// limit is the maximum number of bytes to read from "in", or -1 to read
+// until "in" returns io.EOF. Don't pass an arbitrary large number in place
+// of -1: a finite "limit" is assumed to accurately bound the end of the
+// data (e.g., PushLimit/PopLimit use it to carve out sub-ranges).
 func NewDecoder(
 	in io.Reader,
 	limit int64,
@@ -169,15 +221,59 @@ func (d *Decoder) Read(p []byte) (int, error) {
 		p = p[:desired]
 		desired = int64(len(p))
 	}
-	n, err := d.in.Read(p)
+	n := copy(p, d.peek)
+	d.peek = d.peek[n:]
+	d.pos += int64(n)
+	if n == len(p) {
+		return n, nil
+	}
+	m, err := d.in.Read(p[n:])
 	if err == nil {
-		d.pos += int64(n)
+		d.pos += int64(m)
 	}
-	return n, err
+	return n + m, err
 }
 
-// Len() returns the number of bytes yet unread.
+// PeekTag reports the group and element of the next data element without
+// consuming them, so a caller can decide to skip the element (e.g., via
+// Skip or skipElementValue) before paying the cost of decoding its VR,
+// length, or value.
+func (d *Decoder) PeekTag() (Tag, error) {
+	for len(d.peek) < 4 {
+		buf := make([]byte, 4-len(d.peek))
+		n, err := d.in.Read(buf)
+		if n > 0 {
+			d.peek = append(d.peek, buf[:n]...)
+		}
+		if err != nil {
+			return Tag{}, err
+		}
+	}
+	return Tag{
+		Group:   d.bo.Uint16(d.peek[0:2]),
+		Element: d.bo.Uint16(d.peek[2:4]),
+	}, nil
+}
+
+// SetReader swaps the underlying io.Reader, e.g. to splice in a
+// flate.NewReader partway through a stream (the Deflated Explicit VR
+// Little Endian transfer syntax compresses everything after the File Meta
+// Information group). The caller is responsible for constructing the new
+// reader from whatever remains of the old one; SetReader just installs it
+// and drops any bytes PeekTag had buffered from the old reader, which must
+// be empty at a transfer-syntax boundary.
+func (d *Decoder) SetReader(in io.Reader) {
+	d.in = in
+	d.peek = nil
+}
+
+// Len() returns the number of bytes yet unread, or math.MaxInt64 if the
+// decoder has no limit (see NewDecoder) and so doesn't know in advance
+// where the data ends; such a decoder relies on io.EOF from "in" instead.
 func (d *Decoder) Len() int64 {
+	if d.limit < 0 {
+		return math.MaxInt64
+	}
 	return d.limit - d.pos
 }
 
@@ -264,15 +360,27 @@ func (d *Decoder) DecodeBytes(length int) []byte {
 	return v
 }
 
+// Maximum size of the scratch buffer Skip reuses to discard bytes. Capping
+// it means skipping a multi-GB pixel-data element never allocates more than
+// this much memory.
+const skipBufSize = 1 << 16
+
 func (d *Decoder) Skip(bytes int) {
-	junk := make([]byte, bytes)
-	n, err := d.Read(junk)
-	if err != nil {
-		d.err = err
-		return
-	}
-	if n != bytes {
-		d.err = fmt.Errorf("Failed to skip %d bytes (read %d bytes instead)", bytes, n)
-		return
+	junk := make([]byte, skipBufSize)
+	for bytes > 0 {
+		want := bytes
+		if want > len(junk) {
+			want = len(junk)
+		}
+		n, err := d.Read(junk[:want])
+		bytes -= n
+		if err != nil {
+			d.err = err
+			return
+		}
+		if n != want {
+			d.err = fmt.Errorf("Failed to skip %d bytes (read %d bytes instead)", want, n)
+			return
+		}
 	}
 }
@@ -0,0 +1,12 @@
+package dicom
+
+// DeflatedExplicitVRLittleEndianUID is the transfer syntax UID for Deflated
+// Explicit VR Little Endian. Every byte after the File Meta Information
+// group is compressed with raw RFC 1951 DEFLATE (no zlib header).
+//
+// Both directions are handled inline rather than through a dedicated
+// helper: ParseStream splices a flate.Reader into its Decoder (see
+// Decoder.SetReader), and Write does the same with a flate.Writer before
+// encoding the body, so that SQ and encapsulated PixelData framing goes
+// through the same element-writing path as every other transfer syntax.
+const DeflatedExplicitVRLittleEndianUID = "1.2.840.10008.1.2.1.99"
@@ -10,8 +10,7 @@
 //
 //   func main() {
 //     in, err := os.Open("myfile.dcm")
-//     st, err := in.Stat()
-//     data, err := dicom.Parse(in, st.Size())
+//     data, err := dicom.Parse(in)
 //     if err != nil {
 //         panic(err)
 //     }
@@ -41,51 +40,39 @@ type DicomFile struct {
 	Elements []DicomElement
 }
 
-// ParseBytes(buf) is shorthand for Parse(bytes.NewBuffer(buf), len(buf)).
+// ParseBytes(buf) is shorthand for Parse(bytes.NewBuffer(buf)).
 func ParseBytes(data []byte) (*DicomFile, error) {
-	return Parse(bytes.NewBuffer(data), int64(len(data)))
+	return Parse(bytes.NewBuffer(data))
 }
 
-// Parse up to "bytes" from "io" as DICOM file. Returns a DICOM file struct
-//
-// TODO(saito) Get rid of the "bytes" argument. Detect io.EOF instead.
-func Parse(in io.Reader, bytes int64) (*DicomFile, error) {
-	// buffer := newDicomBuffer(buff) //*di.Bytes)
-	buffer := NewDecoder(in,
-		bytes,
-		binary.LittleEndian,
-		ExplicitVR)
-
-	metaElems := ParseFileHeader(buffer)
-	if buffer.Error() != nil {
-		return nil, buffer.Error()
-	}
-	file := &DicomFile{Elements: metaElems}
-	elem, err := file.LookupElement("TransferSyntaxUID")
-	if err != nil {
-		return nil, err
-	}
-	transferSyntaxUID, err := GetString(*elem)
-	if err != nil {
-		return nil, err
-	}
-	// read endianness and explicit VR
-	endianess, implicit, err := ParseTransferSyntaxUID(transferSyntaxUID)
+// ParseBytesWithOptions is ParseBytes, but with ReadOptions applied.
+func ParseBytesWithOptions(data []byte, opts ReadOptions) (*DicomFile, error) {
+	return ParseWithOptions(bytes.NewBuffer(data), opts)
+}
+
+// Parse reads "in" until io.EOF and returns the resulting DICOM file.
+func Parse(in io.Reader) (*DicomFile, error) {
+	return ParseWithOptions(in, ReadOptions{})
+}
+
+// ParseWithOptions is like Parse, but opts controls which elements are
+// decoded, dropped, or skipped entirely. See ReadOptions for details.
+func ParseWithOptions(in io.Reader, opts ReadOptions) (*DicomFile, error) {
+	stream, err := ParseStream(in, opts)
 	if err != nil {
 		return nil, err
 	}
-	// modify buffer according to new TransferSyntaxUID
-	buffer.bo = endianess
-	buffer.implicit = implicit
-
-	for buffer.Len() != 0 && buffer.Error() == nil {
-		elem := ReadDataElement(buffer)
-		if buffer.Error() != nil {
-			break
+	file := &DicomFile{}
+	for {
+		elem, err := stream.Next()
+		if err == io.EOF {
+			return file, nil
+		}
+		if err != nil {
+			return file, err
 		}
 		file.Elements = append(file.Elements, *elem)
 	}
-	return file, buffer.Finish()
 }
 
 // Consume the DICOM magic header and metadata elements from a Dicom
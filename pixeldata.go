@@ -0,0 +1,301 @@
+package dicom
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"sort"
+	"sync"
+)
+
+// RLELosslessUID is the transfer syntax UID for RLE Lossless (PS3.5 Annex
+// G), the only pixel codec this package implements out of the box.
+// Callers register JPEG / JPEG-LS / JPEG 2000 decoders themselves, e.g.
+// against image/jpeg, via RegisterPixelCodec.
+const RLELosslessUID = "1.2.840.10008.1.2.5"
+
+func init() {
+	RegisterPixelCodec(RLELosslessUID, decodeRLEFrame)
+}
+
+// PixelDataInfo holds an encapsulated PixelData element's Basic Offset
+// Table and fragments without decoding any frame. It's populated by
+// readDataElementWithOptions when it reads an encapsulated PixelData
+// element (undefined length) that ReadOptions didn't drop; retrieve it via
+// the PixelData element's Value[0].
+type PixelDataInfo struct {
+	TransferSyntaxUID string
+	// Offsets is the Basic Offset Table: one byte offset per frame, into
+	// the fragment stream with Fragments concatenated in order.
+	Offsets []uint32
+	// Fragments are the raw, still-encoded item payloads, in stream order.
+	Fragments [][]byte
+
+	file *DicomFile
+}
+
+// RegisterPixelCodec installs decode as the frame decoder for pixel data
+// encoded with the given transfer syntax UID. Register codecs (typically
+// from an init function) before calling DecodeFrames on data using that
+// syntax.
+func RegisterPixelCodec(tsuid string, decode func([]byte, *DicomFile) (image.Image, error)) {
+	pixelCodecsMu.Lock()
+	defer pixelCodecsMu.Unlock()
+	pixelCodecs[tsuid] = decode
+}
+
+var (
+	pixelCodecsMu sync.RWMutex
+	pixelCodecs   = map[string]func([]byte, *DicomFile) (image.Image, error){}
+)
+
+func lookupPixelCodec(tsuid string) (func([]byte, *DicomFile) (image.Image, error), bool) {
+	pixelCodecsMu.RLock()
+	defer pixelCodecsMu.RUnlock()
+	decode, ok := pixelCodecs[tsuid]
+	return decode, ok
+}
+
+// items rebuilds the wire form of an encapsulated PixelData element's
+// items: the Basic Offset Table (one little-endian uint32 per entry of
+// Offsets) as the first item, followed by each of Fragments. This is the
+// inverse of readPixelDataInfo, so Write can round-trip a PixelDataInfo
+// produced by Parse.
+func (p *PixelDataInfo) items() [][]byte {
+	bot := make([]byte, 4*len(p.Offsets))
+	for i, off := range p.Offsets {
+		binary.LittleEndian.PutUint32(bot[4*i:4*i+4], off)
+	}
+	items := make([][]byte, 0, 1+len(p.Fragments))
+	items = append(items, bot)
+	items = append(items, p.Fragments...)
+	return items
+}
+
+// frames groups p.Fragments into one byte slice per frame. When the Basic
+// Offset Table lists more than one frame, fragments are joined according
+// to its offsets (a frame may span several fragments). A single-entry
+// table means exactly one frame, which may still span several fragments,
+// so every fragment is joined into it. Only when the table is empty
+// (non-conformant data with no Basic Offset Table at all) do we fall back
+// to assuming one fragment per frame.
+func (p *PixelDataInfo) frames() ([][]byte, error) {
+	if len(p.Offsets) == 0 {
+		return p.Fragments, nil
+	}
+	if len(p.Offsets) == 1 {
+		return [][]byte{bytes.Join(p.Fragments, nil)}, nil
+	}
+	cum := make([]uint32, len(p.Fragments)+1)
+	for i, f := range p.Fragments {
+		cum[i+1] = cum[i] + uint32(len(f))
+	}
+	starts := make([]int, 0, len(p.Offsets))
+	for _, off := range p.Offsets {
+		idx := sort.Search(len(cum), func(i int) bool { return cum[i] >= off })
+		if idx >= len(cum) || cum[idx] != off {
+			return nil, fmt.Errorf("PixelDataInfo: offset %d does not align with a fragment boundary", off)
+		}
+		starts = append(starts, idx)
+	}
+	frames := make([][]byte, len(starts))
+	for i, start := range starts {
+		end := len(p.Fragments)
+		if i+1 < len(starts) {
+			end = starts[i+1]
+		}
+		frames[i] = bytes.Join(p.Fragments[start:end], nil)
+	}
+	return frames, nil
+}
+
+// DecodeFrames decodes every frame using the codec registered for
+// p.TransferSyntaxUID (see RegisterPixelCodec), fanning the work out across
+// a pool of "concurrency" workers. It returns an error if no codec is
+// registered, or if any frame fails to decode.
+//
+// The codec is handed the DicomFile as seen by the Stream that produced
+// this PixelDataInfo, so if the caller used ReadOptions.ReturnTags to
+// whitelist elements, any geometry tag the codec needs (Rows, Columns,
+// SamplesPerPixel, ...) must be in that whitelist too.
+func (p *PixelDataInfo) DecodeFrames(concurrency int) ([]image.Image, error) {
+	decode, ok := lookupPixelCodec(p.TransferSyntaxUID)
+	if !ok {
+		return nil, fmt.Errorf("PixelDataInfo.DecodeFrames: no codec registered for transfer syntax %s", p.TransferSyntaxUID)
+	}
+	frames, err := p.frames()
+	if err != nil {
+		return nil, err
+	}
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+	images := make([]image.Image, len(frames))
+	errs := make([]error, len(frames))
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i, frame := range frames {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, frame []byte) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			defer func() {
+				// A codec panicking on malformed input (e.g. an
+				// out-of-range slice in decodeRLEFrame) must degrade to
+				// the documented per-frame error, not crash every
+				// concurrent decode in the process.
+				if r := recover(); r != nil {
+					errs[i] = fmt.Errorf("PixelDataInfo.DecodeFrames: frame %d panicked: %v", i, r)
+				}
+			}()
+			images[i], errs[i] = decode(frame, p.file)
+		}(i, frame)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+	return images, nil
+}
+
+// readPixelDataInfo reads an encapsulated PixelData element's items (the
+// tag, VR and undefined length have already been consumed by the caller):
+// the first item is the Basic Offset Table, and every item after it is a
+// fragment, terminated by the sequence delimitation item.
+func readPixelDataInfo(d *Decoder, file *DicomFile, transferSyntaxUID string) *PixelDataInfo {
+	info := &PixelDataInfo{TransferSyntaxUID: transferSyntaxUID, file: file}
+	first := true
+	for d.Error() == nil {
+		tag, err := d.PeekTag()
+		if err != nil {
+			d.SetError(err)
+			return info
+		}
+		d.Skip(4) // consume the tag just peeked
+		itemLen := d.DecodeUInt32()
+		if tag == TagSequenceDelimitationItem {
+			return info
+		}
+		if tag != TagItem {
+			d.SetError(fmt.Errorf("readPixelDataInfo: expected an item tag, got %s", tag.String()))
+			return info
+		}
+		item := d.DecodeBytes(int(itemLen))
+		if first {
+			first = false
+			for i := 0; i+4 <= len(item); i += 4 {
+				info.Offsets = append(info.Offsets, d.bo.Uint32(item[i:i+4]))
+			}
+			continue
+		}
+		info.Fragments = append(info.Fragments, item)
+	}
+	return info
+}
+
+// decodeRLESegment decodes one PS3.5 Annex G RLE segment: for each control
+// byte n, n>=0 copies the next n+1 bytes literally, and n<0 (n != -128)
+// repeats the following byte -n+1 times. -128 is a no-op used for padding.
+func decodeRLESegment(data []byte, expectedLen int) []byte {
+	out := make([]byte, 0, expectedLen)
+	for i := 0; i < len(data) && len(out) < expectedLen; {
+		n := int8(data[i])
+		i++
+		switch {
+		case n >= 0:
+			count := int(n) + 1
+			end := i + count
+			if end > len(data) {
+				end = len(data)
+			}
+			out = append(out, data[i:end]...)
+			i = end
+		case n != -128:
+			if i >= len(data) {
+				return out
+			}
+			count := -int(n) + 1
+			b := data[i]
+			i++
+			for k := 0; k < count && len(out) < expectedLen; k++ {
+				out = append(out, b)
+			}
+		}
+	}
+	return out
+}
+
+// maxRLESegments is the largest segment count PS3.5 Annex G.2 allows: a
+// 64-byte header holding a segment count plus up to 15 offsets.
+const maxRLESegments = 15
+
+// decodeRLEFrame decodes one RLE Lossless frame. It expects Rows, Columns
+// and SamplesPerPixel (grayscale or 3-sample planar RGB) to already be
+// present in "file", which holds the meta elements plus every element the
+// Stream kept (see ReadOptions.ReturnTags) before PixelData.
+func decodeRLEFrame(data []byte, file *DicomFile) (image.Image, error) {
+	rows, err := lookupUShortElement(file, "Rows")
+	if err != nil {
+		return nil, err
+	}
+	cols, err := lookupUShortElement(file, "Columns")
+	if err != nil {
+		return nil, err
+	}
+	samples, err := lookupUShortElement(file, "SamplesPerPixel")
+	if err != nil {
+		samples = 1
+	}
+	if len(data) < 64 {
+		return nil, fmt.Errorf("decodeRLEFrame: header too short (%d bytes)", len(data))
+	}
+	numSegments := binary.LittleEndian.Uint32(data[0:4])
+	if numSegments == 0 || numSegments > maxRLESegments || numSegments != uint32(samples) {
+		return nil, fmt.Errorf("decodeRLEFrame: %d segments but SamplesPerPixel=%d", numSegments, samples)
+	}
+	pixelsPerSegment := int(rows) * int(cols)
+	segments := make([][]byte, numSegments)
+	for i := uint32(0); i < numSegments; i++ {
+		// numSegments <= maxRLESegments and len(data) >= 64 together keep
+		// these header reads in bounds; only the segment bounds below
+		// come from the untrusted offsets themselves.
+		start := binary.LittleEndian.Uint32(data[4+4*i : 8+4*i])
+		end := uint32(len(data))
+		if i+1 < numSegments {
+			end = binary.LittleEndian.Uint32(data[4+4*(i+1) : 8+4*(i+1)])
+		}
+		if start > end || end > uint32(len(data)) {
+			return nil, fmt.Errorf("decodeRLEFrame: segment %d offsets [%d, %d) out of range for a %d-byte frame", i, start, end, len(data))
+		}
+		segments[i] = decodeRLESegment(data[start:end], pixelsPerSegment)
+	}
+	switch numSegments {
+	case 1:
+		img := image.NewGray(image.Rect(0, 0, int(cols), int(rows)))
+		copy(img.Pix, segments[0])
+		return img, nil
+	case 3:
+		img := image.NewNRGBA(image.Rect(0, 0, int(cols), int(rows)))
+		for p := 0; p < pixelsPerSegment; p++ {
+			img.Pix[4*p+0] = segments[0][p]
+			img.Pix[4*p+1] = segments[1][p]
+			img.Pix[4*p+2] = segments[2][p]
+			img.Pix[4*p+3] = 0xff
+		}
+		return img, nil
+	default:
+		return nil, fmt.Errorf("decodeRLEFrame: unsupported SamplesPerPixel=%d", numSegments)
+	}
+}
+
+func lookupUShortElement(file *DicomFile, name string) (uint16, error) {
+	elem, err := file.LookupElement(name)
+	if err != nil {
+		return 0, err
+	}
+	return GetUInt16(*elem)
+}
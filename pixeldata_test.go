@@ -0,0 +1,85 @@
+package dicom
+
+import (
+	"encoding/binary"
+	"image"
+	"testing"
+)
+
+// A Basic Offset Table with exactly one entry means exactly one frame, even
+// when that frame was split across multiple fragments (legal per PS3.5 and
+// common for large single frames); frames must join them all rather than
+// treating each fragment as its own frame.
+func TestPixelDataInfoFramesSingleOffsetMultiFragment(t *testing.T) {
+	info := &PixelDataInfo{
+		Offsets:   []uint32{0},
+		Fragments: [][]byte{[]byte("abc"), []byte("def")},
+	}
+	frames, err := info.frames()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(frames) != 1 {
+		t.Fatalf("got %d frames, want 1", len(frames))
+	}
+	if string(frames[0]) != "abcdef" {
+		t.Errorf("frame = %q, want %q", frames[0], "abcdef")
+	}
+}
+
+func TestPixelDataInfoFramesMultiOffset(t *testing.T) {
+	info := &PixelDataInfo{
+		Offsets:   []uint32{0, 3},
+		Fragments: [][]byte{[]byte("abc"), []byte("def")},
+	}
+	frames, err := info.frames()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(frames) != 2 || string(frames[0]) != "abc" || string(frames[1]) != "def" {
+		t.Errorf("frames = %v, want [abc def]", frames)
+	}
+}
+
+func rleGeometryFile(rows, cols, samples uint16) *DicomFile {
+	return &DicomFile{Elements: []DicomElement{
+		{Tag: Tag{0x0028, 0x0010}, Value: []interface{}{rows}},    // Rows
+		{Tag: Tag{0x0028, 0x0011}, Value: []interface{}{cols}},    // Columns
+		{Tag: Tag{0x0028, 0x0002}, Value: []interface{}{samples}}, // SamplesPerPixel
+	}}
+}
+
+// A segment offset pointing past the end of the frame must be rejected
+// rather than sliced blindly, which would panic.
+func TestDecodeRLEFrameRejectsOutOfRangeSegmentOffset(t *testing.T) {
+	data := make([]byte, 64)
+	binary.LittleEndian.PutUint32(data[0:4], 1)    // numSegments
+	binary.LittleEndian.PutUint32(data[4:8], 1000) // start past len(data)
+	if _, err := decodeRLEFrame(data, rleGeometryFile(2, 2, 1)); err == nil {
+		t.Fatal("expected an error for an out-of-range segment offset, got nil")
+	}
+}
+
+// PS3.5 Annex G.2 caps a frame at 15 segments (the 64-byte header only has
+// room for 15 offsets); a larger count must be rejected up front instead of
+// reading offsets past the header.
+func TestDecodeRLEFrameRejectsTooManySegments(t *testing.T) {
+	data := make([]byte, 64)
+	binary.LittleEndian.PutUint32(data[0:4], 20) // exceeds maxRLESegments
+	if _, err := decodeRLEFrame(data, rleGeometryFile(2, 2, 20)); err == nil {
+		t.Fatal("expected an error for a segment count above the PS3.5 maximum, got nil")
+	}
+}
+
+// A codec that panics on malformed input must turn into a per-frame error,
+// not take down every concurrent DecodeFrames worker with it.
+func TestDecodeFramesRecoversFromCodecPanic(t *testing.T) {
+	const tsuid = "1.2.840.10008.9999.1" // private UID, used only by this test
+	RegisterPixelCodec(tsuid, func(data []byte, file *DicomFile) (image.Image, error) {
+		panic("boom")
+	})
+	info := &PixelDataInfo{TransferSyntaxUID: tsuid, Fragments: [][]byte{[]byte("frame")}}
+	if _, err := info.DecodeFrames(1); err == nil {
+		t.Fatal("expected an error from a panicking codec, got nil")
+	}
+}
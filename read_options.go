@@ -0,0 +1,169 @@
+package dicom
+
+import "fmt"
+
+// undefinedLength is the sentinel VL (0xFFFFFFFF) that marks a sequence or
+// encapsulated pixel-data element whose true length is only known once its
+// delimiter item is reached.
+const undefinedLength = 0xFFFFFFFF
+
+// ReadOptions customizes how Parse, ParseBytes, and ParseWithOptions read a
+// DICOM stream. The zero value reads every element into memory, matching
+// the historical behavior of Parse.
+type ReadOptions struct {
+	// DropPixelData skips over the PixelData element (7FE0,0010) instead of
+	// decoding it, which avoids materializing the bulk of a study in
+	// memory. Encapsulated pixel data (an undefined-length sequence of
+	// items) is skipped by walking its items rather than trusting a single
+	// length field.
+	DropPixelData bool
+
+	// ReturnTags, when non-empty, whitelists which elements are appended to
+	// DicomFile.Elements. Elements whose tag isn't listed are still
+	// consumed from the stream so that parsing can continue, but are
+	// dropped rather than returned to the caller.
+	//
+	// This interacts with PixelDataInfo.DecodeFrames: a registered codec
+	// (e.g. decodeRLEFrame) resolves things like Rows/Columns/
+	// SamplesPerPixel by looking them up in the elements the Stream has
+	// seen so far, which is exactly this whitelist. A caller who sets
+	// ReturnTags to just PixelData to stream only pixel bytes must also
+	// list whatever geometry tags their codec needs, or DecodeFrames will
+	// fail to resolve them.
+	ReturnTags []Tag
+
+	// StopAtTag, when set, halts parsing as soon as the next element's tag
+	// is >= *StopAtTag, without reading that element at all. This avoids
+	// paying for trailing bulk data (typically PixelData) when the caller
+	// only wants leading elements.
+	StopAtTag *Tag
+}
+
+// keepTag reports whether an element with the given tag should be appended
+// to DicomFile.Elements under these options.
+func (o ReadOptions) keepTag(tag Tag) bool {
+	if len(o.ReturnTags) == 0 {
+		return true
+	}
+	for _, t := range o.ReturnTags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// tagLess reports whether "a" sorts before "b" in tag order (group, then
+// element).
+func tagLess(a, b Tag) bool {
+	if a.Group != b.Group {
+		return a.Group < b.Group
+	}
+	return a.Element < b.Element
+}
+
+// hasExplicitVRLongForm reports whether, under explicit VR, "vr" is encoded
+// with two reserved bytes followed by a 4-byte length, rather than a plain
+// 2-byte length.
+func hasExplicitVRLongForm(vr string) bool {
+	switch vr {
+	case "OB", "OW", "OF", "SQ", "UT", "UN":
+		return true
+	default:
+		return false
+	}
+}
+
+// skipElementValue discards an element's value without decoding it. For a
+// defined length, it just skips "vl" bytes. For an undefined length
+// (encapsulated pixel data, or a sequence that happens to reach this path),
+// it walks the item stream until the sequence delimitation item, since the
+// true byte length isn't known up front.
+func skipElementValue(d *Decoder, vl uint32) {
+	if vl != undefinedLength {
+		d.Skip(int(vl))
+		return
+	}
+	for d.Error() == nil {
+		tag, err := d.PeekTag()
+		if err != nil {
+			d.SetError(err)
+			return
+		}
+		d.Skip(4) // consume the tag just peeked
+		itemLen := d.DecodeUInt32()
+		if tag == TagSequenceDelimitationItem {
+			return
+		}
+		if itemLen == undefinedLength {
+			d.SetError(fmt.Errorf("skipElementValue: item at %s has undefined length", tag.String()))
+			return
+		}
+		d.Skip(int(itemLen))
+	}
+}
+
+// readDataElementWithOptions reads the next data element, honoring opts.
+// "file" holds the meta elements plus every element the current Stream has
+// kept so far, i.e. those that passed ReturnTags (used to
+// resolve Rows/Columns/etc. when decoding encapsulated PixelData) and
+// "transferSyntaxUID" is stamped onto any PixelDataInfo it produces.
+//
+// It returns (elem, keep) where keep reports whether elem should be
+// appended to DicomFile.Elements; (nil, false) with d.Error()==nil signals
+// that StopAtTag was reached and parsing should end cleanly.
+func readDataElementWithOptions(d *Decoder, opts ReadOptions, file *DicomFile, transferSyntaxUID string) (*DicomElement, bool) {
+	tag, err := d.PeekTag()
+	if err != nil {
+		d.SetError(err)
+		return nil, false
+	}
+	if opts.StopAtTag != nil && !tagLess(tag, *opts.StopAtTag) {
+		return nil, false
+	}
+	if tag == TagPixelData {
+		// PixelData's value can be huge, so unlike other elements we read
+		// its header ourselves instead of handing off to ReadDataElement:
+		// that lets DropPixelData skip the value outright, and lets an
+		// encapsulated value turn into a PixelDataInfo rather than a
+		// fully materialized byte slice.
+		d.Skip(4) // group, element
+		var vr string
+		var vl uint32
+		if d.implicit {
+			vl = d.DecodeUInt32()
+		} else {
+			vr = d.DecodeString(2)
+			if hasExplicitVRLongForm(vr) {
+				d.Skip(2) // reserved
+				vl = d.DecodeUInt32()
+			} else {
+				vl = uint32(d.DecodeUInt16())
+			}
+		}
+		if opts.DropPixelData {
+			skipElementValue(d, vl)
+			if d.Error() != nil {
+				return nil, false
+			}
+			return &DicomElement{Tag: tag, Vr: vr, Vl: vl}, false
+		}
+		if vl == undefinedLength {
+			info := readPixelDataInfo(d, file, transferSyntaxUID)
+			if d.Error() != nil {
+				return nil, false
+			}
+			return &DicomElement{Tag: tag, Vr: vr, Vl: vl, Value: []interface{}{info}}, opts.keepTag(tag)
+		}
+		data := d.DecodeBytes(int(vl))
+		if d.Error() != nil {
+			return nil, false
+		}
+		return &DicomElement{Tag: tag, Vr: vr, Vl: vl, Value: []interface{}{data}}, opts.keepTag(tag)
+	}
+	elem := ReadDataElement(d)
+	if d.Error() != nil {
+		return nil, false
+	}
+	return elem, opts.keepTag(tag)
+}
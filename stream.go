@@ -0,0 +1,130 @@
+package dicom
+
+import (
+	"compress/flate"
+	"encoding/binary"
+	"io"
+)
+
+// Stream is a pull-style iterator over the elements of a DICOM file. Unlike
+// Parse, it never buffers the whole file: elements are decoded (or, under
+// ReadOptions, skipped) one at a time as Next is called, which lets a
+// caller process a multi-GB study with bounded memory.
+type Stream struct {
+	d                 *Decoder
+	opts              ReadOptions
+	transferSyntaxUID string
+
+	// Elements already read but not yet returned by Next: the meta
+	// elements, read eagerly by ParseStream to determine the transfer
+	// syntax.
+	queue []DicomElement
+
+	// file accumulates every element seen so far (meta elements, plus
+	// whatever Next has already returned), so that decoding an
+	// encapsulated PixelData element can resolve things like Rows and
+	// Columns from earlier in the same stream.
+	file *DicomFile
+
+	done bool
+}
+
+// ParseStream reads the DICOM magic header and meta elements from "in",
+// then returns a Stream over the remaining elements. "in" need not support
+// seeking or know its own length in advance; Next detects the end of the
+// file from io.EOF.
+func ParseStream(in io.Reader, opts ReadOptions) (*Stream, error) {
+	d := NewDecoder(in, -1, binary.LittleEndian, ExplicitVR)
+	metaElems := ParseFileHeader(d)
+	if d.Error() != nil {
+		return nil, d.Error()
+	}
+	elem, err := LookupElementByName(metaElems, "TransferSyntaxUID")
+	if err != nil {
+		return nil, err
+	}
+	transferSyntaxUID, err := GetString(*elem)
+	if err != nil {
+		return nil, err
+	}
+	if transferSyntaxUID == DeflatedExplicitVRLittleEndianUID {
+		// Everything past the meta group is raw DEFLATE (RFC 1951, no
+		// zlib header); splice a flate reader in front of the rest of
+		// the stream and decode it as plain explicit VR little endian.
+		d.bo = binary.LittleEndian
+		d.implicit = ExplicitVR
+		d.SetReader(flate.NewReader(d.in))
+	} else {
+		endianess, implicit, err := ParseTransferSyntaxUID(transferSyntaxUID)
+		if err != nil {
+			return nil, err
+		}
+		d.bo = endianess
+		d.implicit = implicit
+	}
+	return &Stream{
+		d:                 d,
+		opts:              opts,
+		transferSyntaxUID: transferSyntaxUID,
+		queue:             metaElems,
+		file:              &DicomFile{Elements: append([]DicomElement{}, metaElems...)},
+	}, nil
+}
+
+// Next returns the next element that passes opts' filters (see
+// ReadOptions). It returns io.EOF once the underlying reader is exhausted,
+// or once opts.StopAtTag is reached.
+func (s *Stream) Next() (*DicomElement, error) {
+	for {
+		if len(s.queue) > 0 {
+			elem := s.queue[0]
+			s.queue = s.queue[1:]
+			if !s.opts.keepTag(elem.Tag) {
+				continue // filtered out by ReturnTags
+			}
+			return &elem, nil
+		}
+		if s.done {
+			return nil, io.EOF
+		}
+		elem, keep := readDataElementWithOptions(s.d, s.opts, s.file, s.transferSyntaxUID)
+		if err := s.d.Error(); err != nil {
+			s.done = true
+			if err == io.EOF {
+				return nil, io.EOF
+			}
+			return nil, err
+		}
+		if elem == nil {
+			s.done = true // StopAtTag reached.
+			return nil, io.EOF
+		}
+		if keep {
+			s.file.Elements = append(s.file.Elements, *elem)
+			return elem, nil
+		}
+		// Filtered out by ReturnTags; loop around for the next element.
+	}
+}
+
+// ParseCallback is a push-style variant of ParseStream: cb is invoked once
+// per retained element, in order, until the stream is exhausted or cb
+// returns an error.
+func ParseCallback(in io.Reader, cb func(*DicomElement) error, opts ReadOptions) error {
+	s, err := ParseStream(in, opts)
+	if err != nil {
+		return err
+	}
+	for {
+		elem, err := s.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := cb(elem); err != nil {
+			return err
+		}
+	}
+}
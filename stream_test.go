@@ -0,0 +1,187 @@
+package dicom_test
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"io"
+	"testing"
+
+	"github.com/yasushi-saito/go-dicom"
+)
+
+const explicitVRLittleEndianUID = "1.2.840.10008.1.2.1"
+
+var tagPatientName = dicom.Tag{0x0010, 0x0010}
+var tagPatientID = dicom.Tag{0x0010, 0x0020}
+
+func buildTestFile(t *testing.T, transferSyntaxUID string, withPixelData bool) []byte {
+	headerEncoder := dicom.NewEncoder(binary.LittleEndian, dicom.ExplicitVR)
+	dicom.WriteFileHeader(headerEncoder, transferSyntaxUID, "1.2.3", "1.2.3.4")
+	headerBytes, err := headerEncoder.Finish()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e := dicom.NewEncoder(binary.LittleEndian, dicom.ExplicitVR)
+	dicom.EncodeDataElement(e, &dicom.DicomElement{Tag: tagPatientName, Value: []interface{}{"Doe^John"}})
+	dicom.EncodeDataElement(e, &dicom.DicomElement{Tag: tagPatientID, Value: []interface{}{"12345"}})
+	if withPixelData {
+		dicom.EncodeDataElement(e, &dicom.DicomElement{Tag: dicom.TagPixelData, Value: []interface{}{[]byte{1, 2, 3, 4}}})
+	}
+	body, err := e.Finish()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if transferSyntaxUID == dicom.DeflatedExplicitVRLittleEndianUID {
+		var compressed bytes.Buffer
+		fw, err := flate.NewWriter(&compressed, flate.DefaultCompression)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := fw.Write(body); err != nil {
+			t.Fatal(err)
+		}
+		if err := fw.Close(); err != nil {
+			t.Fatal(err)
+		}
+		body = compressed.Bytes()
+	}
+	return append(headerBytes, body...)
+}
+
+
+func TestParseRoundTrip(t *testing.T) {
+	data := buildTestFile(t, explicitVRLittleEndianUID, false)
+	file, err := dicom.ParseBytes(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	elem, err := dicom.LookupElementByTag(file.Elements, tagPatientName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := dicom.GetString(*elem); err != nil || got != "Doe^John" {
+		t.Errorf("PatientName = %q, %v; want %q, nil", got, err, "Doe^John")
+	}
+}
+
+
+func TestParseCallback(t *testing.T) {
+	data := buildTestFile(t, explicitVRLittleEndianUID, false)
+	var tags []dicom.Tag
+	err := dicom.ParseCallback(bytes.NewReader(data), func(elem *dicom.DicomElement) error {
+		tags = append(tags, elem.Tag)
+		return nil
+	}, dicom.ReadOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := false
+	for _, tag := range tags {
+		if tag == tagPatientName {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("ParseCallback never saw PatientName, tags=%v", tags)
+	}
+}
+
+
+func TestParseCallbackPropagatesCallbackError(t *testing.T) {
+	data := buildTestFile(t, explicitVRLittleEndianUID, false)
+	wantErr := io.ErrClosedPipe
+	err := dicom.ParseCallback(bytes.NewReader(data), func(elem *dicom.DicomElement) error {
+		return wantErr
+	}, dicom.ReadOptions{})
+	if err != wantErr {
+		t.Errorf("err = %v, want %v", err, wantErr)
+	}
+}
+
+func TestReadOptionsDropPixelData(t *testing.T) {
+	data := buildTestFile(t, explicitVRLittleEndianUID, true)
+	file, err := dicom.ParseBytesWithOptions(data, dicom.ReadOptions{DropPixelData: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dicom.LookupElementByTag(file.Elements, dicom.TagPixelData); err == nil {
+		t.Error("PixelData should have been dropped, but was returned")
+	}
+	if _, err := dicom.LookupElementByTag(file.Elements, tagPatientName); err != nil {
+		t.Error("PatientName should still be present")
+	}
+}
+
+func TestReadOptionsReturnTags(t *testing.T) {
+	data := buildTestFile(t, explicitVRLittleEndianUID, false)
+	file, err := dicom.ParseBytesWithOptions(data, dicom.ReadOptions{ReturnTags: []dicom.Tag{tagPatientName}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dicom.LookupElementByTag(file.Elements, tagPatientID); err == nil {
+		t.Error("PatientID should have been filtered out by ReturnTags")
+	}
+	if _, err := dicom.LookupElementByTag(file.Elements, tagPatientName); err != nil {
+		t.Error("PatientName should have passed the ReturnTags whitelist")
+	}
+}
+
+func TestReadOptionsStopAtTag(t *testing.T) {
+	data := buildTestFile(t, explicitVRLittleEndianUID, false)
+	stop := tagPatientID
+	file, err := dicom.ParseBytesWithOptions(data, dicom.ReadOptions{StopAtTag: &stop})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dicom.LookupElementByTag(file.Elements, tagPatientID); err == nil {
+		t.Error("PatientID should not have been reached past StopAtTag")
+	}
+	if _, err := dicom.LookupElementByTag(file.Elements, tagPatientName); err != nil {
+		t.Error("PatientName comes before StopAtTag and should be present")
+	}
+}
+
+func TestParseDeflatedTransferSyntax(t *testing.T) {
+	data := buildTestFile(t, dicom.DeflatedExplicitVRLittleEndianUID, false)
+	file, err := dicom.ParseBytes(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	elem, err := dicom.LookupElementByTag(file.Elements, tagPatientID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := dicom.GetString(*elem); err != nil || got != "12345" {
+		t.Errorf("PatientID = %q, %v; want %q, nil", got, err, "12345")
+	}
+}
+
+// Write's deflate branch (flate.Writer wrapping + explicit Close) must
+// produce a stream Parse can read back, not just an error-free call.
+func TestWriteDeflatedTransferSyntaxRoundTrip(t *testing.T) {
+	file := &dicom.DicomFile{Elements: []dicom.DicomElement{
+		{Tag: tagPatientName, Value: []interface{}{"Doe^John"}},
+		{Tag: tagPatientID, Value: []interface{}{"12345"}},
+	}}
+	var buf bytes.Buffer
+	opts := dicom.WriteOptions{TransferSyntaxUID: dicom.DeflatedExplicitVRLittleEndianUID}
+	if err := dicom.Write(&buf, file, opts); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := dicom.ParseBytes(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	elem, err := dicom.LookupElementByTag(got.Elements, tagPatientID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s, err := dicom.GetString(*elem); err != nil || s != "12345" {
+		t.Errorf("PatientID = %q, %v; want %q, nil", s, err, "12345")
+	}
+}
+
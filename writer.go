@@ -0,0 +1,200 @@
+package dicom
+
+import (
+	"compress/flate"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// WriteOptions customizes Write.
+type WriteOptions struct {
+	// TransferSyntaxUID is used when "file" has no TransferSyntaxUID meta
+	// element of its own.
+	TransferSyntaxUID string
+}
+
+// Write serializes "file" to "out": a File Meta Information group followed
+// by every non-meta element, encoded under the transfer syntax found in
+// file.Elements (falling back to opts.TransferSyntaxUID). SQ elements are
+// written with an undefined length and defined-length items, and a
+// PixelData element with an undefined length is written as encapsulated: a
+// Basic Offset Table rebuilt from its PixelDataInfo's Offsets, followed by
+// its Fragments, one item each, exactly as stored. Fragments are not
+// regrouped into one item per frame. See writeSequence and
+// writeEncapsulatedPixelData.
+func Write(out io.Writer, file *DicomFile, opts WriteOptions) error {
+	transferSyntaxUID := opts.TransferSyntaxUID
+	if elem, err := LookupElementByName(file.Elements, "TransferSyntaxUID"); err == nil {
+		if uid, err := GetString(*elem); err == nil {
+			transferSyntaxUID = uid
+		}
+	}
+	if transferSyntaxUID == "" {
+		return fmt.Errorf("dicom.Write: no TransferSyntaxUID in file.Elements or WriteOptions")
+	}
+	sopClassUID, _ := lookupOptionalString(file.Elements, "MediaStorageSOPClassUID")
+	sopInstanceUID, _ := lookupOptionalString(file.Elements, "MediaStorageSOPInstanceUID")
+
+	headerEncoder := NewEncoder(binary.LittleEndian, ExplicitVR)
+	WriteFileHeader(headerEncoder, transferSyntaxUID, sopClassUID, sopInstanceUID)
+	headerBytes, err := headerEncoder.Finish()
+	if err != nil {
+		return err
+	}
+	if _, err := out.Write(headerBytes); err != nil {
+		return err
+	}
+
+	bodyOut := out
+	bo := binary.ByteOrder(binary.LittleEndian)
+	implicit := IsImplicitVR(ExplicitVR)
+	var fw *flate.Writer
+	if transferSyntaxUID == DeflatedExplicitVRLittleEndianUID {
+		fw, err = flate.NewWriter(out, flate.DefaultCompression)
+		if err != nil {
+			return err
+		}
+		bodyOut = fw
+	} else {
+		bo, implicit, err = ParseTransferSyntaxUID(transferSyntaxUID)
+		if err != nil {
+			return err
+		}
+	}
+
+	e := NewEncoder(bo, implicit)
+	e.SetWriter(bodyOut)
+	for i := range file.Elements {
+		elem := &file.Elements[i]
+		if elem.Tag.Group == 0x0002 {
+			continue // already emitted as part of the File Meta Information group
+		}
+		writeElement(e, elem)
+		if e.Error() != nil {
+			return e.Error()
+		}
+	}
+	if err := e.Error(); err != nil {
+		return err
+	}
+	if fw != nil {
+		// Close flushes the final compressed block; a deferred, ignored
+		// Close would let a flush failure (disk full, broken pipe, ...)
+		// masquerade as a successful Write.
+		return fw.Close()
+	}
+	return nil
+}
+
+func lookupOptionalString(elems []DicomElement, name string) (string, error) {
+	elem, err := LookupElementByName(elems, name)
+	if err != nil {
+		return "", err
+	}
+	return GetString(*elem)
+}
+
+func writeElement(e *Encoder, elem *DicomElement) {
+	switch {
+	case elem.Vr == "SQ":
+		writeSequence(e, elem)
+	case elem.Tag == TagPixelData && elem.Vl == undefinedLength:
+		writeEncapsulatedPixelData(e, elem)
+	default:
+		EncodeDataElement(e, elem)
+	}
+}
+
+// encodeElementHeader writes a tag, and (for explicit VR) its VR, followed
+// by "vl". It's used for the framing EncodeDataElement doesn't cover:
+// SQ elements and encapsulated PixelData, both written with an undefined
+// length and a matching delimiter rather than a single up-front value.
+func encodeElementHeader(e *Encoder, tag Tag, vr string, vl uint32) {
+	e.EncodeUInt16(tag.Group)
+	e.EncodeUInt16(tag.Element)
+	if e.implicit {
+		e.EncodeUInt32(vl)
+		return
+	}
+	e.EncodeString(vr)
+	if hasExplicitVRLongForm(vr) {
+		e.EncodeUInt16(0) // reserved
+		e.EncodeUInt32(vl)
+	} else {
+		e.EncodeUInt16(uint16(vl))
+	}
+}
+
+func encodeDelimiter(e *Encoder, tag Tag) {
+	e.EncodeUInt16(tag.Group)
+	e.EncodeUInt16(tag.Element)
+	e.EncodeUInt32(0)
+}
+
+// encodeItemHeader writes a (FFFE,E000) item tag followed by its bare
+// 4-byte length. Items never carry a VR field, under any transfer syntax
+// (unlike encodeElementHeader's explicit-VR elements, which pick a 2- or
+// 4-byte length form based on VR); using encodeElementHeader here would
+// write a 2-byte length under explicit VR and truncate every item over
+// 64KB, corrupting the rest of the stream.
+func encodeItemHeader(e *Encoder, vl uint32) {
+	e.EncodeUInt16(TagItem.Group)
+	e.EncodeUInt16(TagItem.Element)
+	e.EncodeUInt32(vl)
+}
+
+// writeSequence encodes a VR=SQ element with an undefined length: a
+// (FFFE,E000) item header carrying the item's explicit 4-byte length and its
+// nested elements for each entry of elem.Value (each of which must be a
+// []*DicomElement), closed by a (FFFE,E0DD) sequence delimiter. Items have
+// defined lengths, so no (FFFE,E00D) item delimiter is written.
+func writeSequence(e *Encoder, elem *DicomElement) {
+	encodeElementHeader(e, elem.Tag, "SQ", undefinedLength)
+	for _, v := range elem.Value {
+		items, ok := v.([]*DicomElement)
+		if !ok {
+			e.SetError(fmt.Errorf("writeSequence: %s: item value has unexpected type %T", elem.Tag.String(), v))
+			return
+		}
+		itemEncoder := NewEncoder(e.bo, IsImplicitVR(e.implicit))
+		for _, sub := range items {
+			writeElement(itemEncoder, sub)
+		}
+		itemBytes, err := itemEncoder.Finish()
+		if err != nil {
+			e.SetError(err)
+			return
+		}
+		encodeItemHeader(e, uint32(len(itemBytes)))
+		e.EncodeBytes(itemBytes)
+	}
+	encodeDelimiter(e, TagSequenceDelimitationItem)
+}
+
+// writeEncapsulatedPixelData encodes a PixelData element whose Value is a
+// single *PixelDataInfo, the same type readDataElementWithOptions produces
+// when it reads encapsulated pixel data: the Basic Offset Table is
+// rebuilt from its Offsets, followed by each of its Fragments, one item
+// per entry.
+func writeEncapsulatedPixelData(e *Encoder, elem *DicomElement) {
+	info, ok := singlePixelDataInfo(elem.Value)
+	if !ok {
+		e.SetError(fmt.Errorf("writeEncapsulatedPixelData: %s: expected a single *PixelDataInfo value, got %v", elem.Tag.String(), elem.Value))
+		return
+	}
+	encodeElementHeader(e, elem.Tag, elem.Vr, undefinedLength)
+	for _, item := range info.items() {
+		encodeItemHeader(e, uint32(len(item)))
+		e.EncodeBytes(item)
+	}
+	encodeDelimiter(e, TagSequenceDelimitationItem)
+}
+
+func singlePixelDataInfo(value []interface{}) (*PixelDataInfo, bool) {
+	if len(value) != 1 {
+		return nil, false
+	}
+	info, ok := value[0].(*PixelDataInfo)
+	return info, ok
+}
@@ -0,0 +1,73 @@
+package dicom
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+// A 2-byte item length field would truncate any item over 64KB and shift
+// everything written after it; verify writeSequence uses the mandatory
+// 4-byte form instead.
+func TestWriteSequenceItemHeaderUsesFourByteLength(t *testing.T) {
+	big := DicomElement{
+		Tag:   Tag{0x0008, 0x0008},
+		Value: []interface{}{string(make([]byte, 70000))},
+	}
+	sq := &DicomElement{
+		Tag:   Tag{0x0008, 0x1115},
+		Vr:    "SQ",
+		Value: []interface{}{[]*DicomElement{&big}},
+	}
+	e := NewEncoder(binary.LittleEndian, ExplicitVR)
+	writeSequence(e, sq)
+	data, err := e.Finish()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d := NewBytesDecoder(data, binary.LittleEndian, ExplicitVR)
+	d.Skip(4 + 2 + 2) // SQ element: tag, VR, reserved
+	if sqLen := d.DecodeUInt32(); sqLen != undefinedLength {
+		t.Errorf("SQ length = %#x, want undefined length", sqLen)
+	}
+	d.Skip(4) // item tag; items never carry a VR field
+	if itemLen := d.DecodeUInt32(); itemLen <= 0xFFFF {
+		t.Fatalf("item length = %d, want > 65535 (a 2-byte length field would have truncated it)", itemLen)
+	}
+}
+
+// writeEncapsulatedPixelData must accept the *PixelDataInfo value that
+// readDataElementWithOptions produces, and readPixelDataInfo must be able to
+// read it back, so that Parse -> Write round-trips an encapsulated file.
+func TestWriteEncapsulatedPixelDataRoundTrip(t *testing.T) {
+	info := &PixelDataInfo{
+		TransferSyntaxUID: RLELosslessUID,
+		Offsets:           []uint32{0},
+		Fragments:         [][]byte{[]byte("frag0"), []byte("frag1")},
+	}
+	elem := &DicomElement{
+		Tag:   TagPixelData,
+		Vr:    "OB",
+		Vl:    undefinedLength,
+		Value: []interface{}{info},
+	}
+	e := NewEncoder(binary.LittleEndian, ExplicitVR)
+	writeEncapsulatedPixelData(e, elem)
+	data, err := e.Finish()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d := NewBytesDecoder(data, binary.LittleEndian, ExplicitVR)
+	d.Skip(4 + 2 + 2 + 4) // tag, VR, reserved, 4-byte undefined length
+	got := readPixelDataInfo(d, nil, RLELosslessUID)
+	if d.Error() != nil {
+		t.Fatal(d.Error())
+	}
+	if len(got.Offsets) != 1 || got.Offsets[0] != 0 {
+		t.Errorf("Offsets = %v, want [0]", got.Offsets)
+	}
+	if len(got.Fragments) != 2 || string(got.Fragments[0]) != "frag0" || string(got.Fragments[1]) != "frag1" {
+		t.Errorf("Fragments = %v, want [frag0 frag1]", got.Fragments)
+	}
+}